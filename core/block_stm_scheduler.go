@@ -0,0 +1,291 @@
+package core
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ExecutionMode selects the scheduling strategy used to run a block's
+// transactions in parallel.
+type ExecutionMode int32
+
+const (
+	// ModeDAG runs transactions level-by-level according to a pre-computed
+	// types.TxDAG, see TxLevels.Run.
+	ModeDAG ExecutionMode = iota
+	// ModeBlockSTM runs transactions optimistically without a DAG, validating
+	// and re-executing on conflict, see BlockSTM.Run.
+	ModeBlockSTM
+)
+
+var executionMode int32 = int32(ModeDAG)
+
+// SetExecutionMode selects the scheduling strategy used by Execute.
+func SetExecutionMode(mode ExecutionMode) {
+	atomic.StoreInt32(&executionMode, int32(mode))
+}
+
+// CurrentExecutionMode returns the scheduling strategy configured via
+// SetExecutionMode. It defaults to ModeDAG.
+func CurrentExecutionMode() ExecutionMode {
+	return ExecutionMode(atomic.LoadInt32(&executionMode))
+}
+
+// mvKey identifies a single versioned storage location read or written by a
+// speculative execution.
+type mvKey struct {
+	addr common.Address
+	slot common.Hash
+}
+
+// mvVersion identifies the incarnation of a transaction that produced a
+// value observed through the multi-version store.
+type mvVersion struct {
+	txIndex     int
+	incarnation int
+}
+
+// ReadSet is the set of versioned locations a speculative execution observed,
+// keyed by the version it read at the time.
+type ReadSet map[mvKey]mvVersion
+
+// WriteSet is the set of locations a speculative execution wrote, along with
+// the value written.
+type WriteSet map[mvKey]common.Hash
+
+// RWRecorder may be implemented by a *PEVMTxResult produced by a BlockSTM
+// worker. It exposes the read/write set captured during speculative execution
+// so the validator can check it against the multi-version store. It is only
+// consulted when no RWSetCapturer is installed; a result for which neither
+// yields a read/write set is trusted as-is, same as a level run under ModeDAG.
+type RWRecorder interface {
+	ReadSet() ReadSet
+	WriteSet() WriteSet
+}
+
+// RWSetCapturer recovers the read/write set a speculative execution observed
+// from its result. It exists because read/write-set capture happens in the
+// EVM state layer, not on the scheduler's own PEVMTxResult type, so a result
+// generally can't implement RWRecorder itself; install a capturer with
+// SetRWSetCapturer to wire it in, the same way SetAccessHinter and
+// SetCostEstimator wire in production behavior elsewhere in this package.
+// The ok return distinguishes "no read/write set" from "nothing observed".
+type RWSetCapturer func(*PEVMTxResult) (rs ReadSet, ws WriteSet, ok bool)
+
+var rwSetCapturer RWSetCapturer
+
+// SetRWSetCapturer installs the capturer BlockSTM and confirmQueue use to
+// recover a result's read/write set. Passing nil removes the capturer, so only
+// results that implement RWRecorder are checked and the rest are trusted
+// as-is, same as a level run under ModeDAG.
+func SetRWSetCapturer(f RWSetCapturer) {
+	rwSetCapturer = f
+}
+
+// readWriteSetOf returns the read/write set observed producing res. It uses
+// the installed RWSetCapturer when there is one, and otherwise falls back to
+// res's own RWRecorder implementation, so either integration path works.
+func readWriteSetOf(res *PEVMTxResult) (ReadSet, WriteSet, bool) {
+	if rwSetCapturer != nil {
+		return rwSetCapturer(res)
+	}
+	if rw, ok := any(res).(RWRecorder); ok {
+		return rw.ReadSet(), rw.WriteSet(), true
+	}
+	return nil, nil, false
+}
+
+// mvMemory is the multi-version in-memory store BlockSTM workers read and
+// write through, keyed by (address, slot).
+type mvMemory struct {
+	mu      sync.RWMutex
+	entries map[mvKey][]mvVersionedValue
+}
+
+type mvVersionedValue struct {
+	version mvVersion
+	value   common.Hash
+}
+
+func newMVMemory() *mvMemory {
+	return &mvMemory{entries: make(map[mvKey][]mvVersionedValue)}
+}
+
+// read returns the latest version written to key by a tx below txIndex, i.e.
+// the entry with the highest txIndex strictly less than txIndex. entries are
+// appended in whatever order concurrent workers finish, not sorted by
+// txIndex, so this must scan all of them rather than stop at the first
+// match.
+func (m *mvMemory) read(key mvKey, txIndex int) (mvVersion, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := m.entries[key]
+	best, found := mvVersion{}, false
+	for _, e := range entries {
+		if e.version.txIndex < txIndex && (!found || e.version.txIndex > best.txIndex) {
+			best, found = e.version, true
+		}
+	}
+	return best, found
+}
+
+// write records a tx's write to key at the given incarnation, replacing any
+// earlier write by the same tx index.
+func (m *mvMemory) write(key mvKey, version mvVersion, value common.Hash) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := m.entries[key]
+	for i, e := range entries {
+		if e.version.txIndex == version.txIndex {
+			entries[i] = mvVersionedValue{version, value}
+			return
+		}
+	}
+	m.entries[key] = append(entries, mvVersionedValue{version, value})
+}
+
+// remove deletes txIndex's entry for key, if it has one. It is used to drop a
+// stale incarnation's write to a key the next incarnation no longer writes,
+// so a higher-indexed tx can never validate against a write its writer's
+// committed incarnation doesn't actually produce.
+func (m *mvMemory) remove(key mvKey, txIndex int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := m.entries[key]
+	for i, e := range entries {
+		if e.version.txIndex == txIndex {
+			m.entries[key] = append(entries[:i], entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// BlockSTM executes a flat (unordered) batch of transactions without a
+// pre-computed types.TxDAG, in the style of Block-STM: every tx is executed
+// speculatively against a multi-version store, and a sequential validator
+// re-executes and bumps the incarnation of any tx whose recorded reads no
+// longer match the latest lower-indexed write.
+type BlockSTM struct {
+	txs TxLevel
+}
+
+// NewBlockSTM builds a BlockSTM executor over all transactions of a block.
+// Unlike NewTxLevels, no dependency hints are required.
+func NewBlockSTM(all []*PEVMTxRequest) *BlockSTM {
+	return &BlockSTM{txs: all}
+}
+
+// Run executes and confirms every transaction, returning once every index has
+// been validated successfully at its latest incarnation. confirm is always
+// invoked on the validator goroutine in committed (tx index) order, so
+// state-root computation remains deterministic.
+func (b *BlockSTM) Run(execute func(*PEVMTxRequest) *PEVMTxResult, confirm func(*PEVMTxResult) error) (error, int) {
+	n := len(b.txs)
+	if n == 0 {
+		return nil, 0
+	}
+
+	mem := newMVMemory()
+	incarnations := make([]int, n)
+	results := make([]*PEVMTxResult, n)
+	needsExec := make([]bool, n)
+	prevWrites := make([]WriteSet, n)
+	for i := range needsExec {
+		needsExec[i] = true
+	}
+
+	runOne := func(tx *PEVMTxRequest) {
+		i := tx.txIndex
+		res := execute(tx)
+		results[i] = res
+		needsExec[i] = false
+		_, ws, _ := readWriteSetOf(res)
+		// this incarnation no longer writes some key the previous one did: drop
+		// that stale entry so a higher-indexed tx can't validate against it.
+		for key := range prevWrites[i] {
+			if _, stillWritten := ws[key]; !stillWritten {
+				mem.remove(key, i)
+			}
+		}
+		prevWrites[i] = ws
+		for key, value := range ws {
+			mem.write(key, mvVersion{txIndex: i, incarnation: incarnations[i]}, value)
+		}
+	}
+
+	// initial speculative wave, dispatched the same way TxLevels.run splits a
+	// level: run inline below the parallel threshold, otherwise chunk by
+	// estimated cost across the worker pool so small blocks, and one heavy
+	// tx among light ones, don't pay disproportionate channel overhead.
+	if n < ParallelThreshold() {
+		for _, tx := range b.txs {
+			runOne(tx)
+		}
+	} else {
+		chunks := b.txs.SplitByCost(runtime.NumCPU())
+		wait := sync.WaitGroup{}
+		wait.Add(len(chunks))
+		for _, chunk := range chunks {
+			temp := chunk
+			runner <- func() {
+				for _, tx := range temp {
+					runOne(tx)
+				}
+				wait.Done()
+			}
+		}
+		wait.Wait()
+	}
+
+	// sequential validation: re-execute and re-validate until every index
+	// passes with its current incarnation, then confirm in order.
+	validated := 0
+	for validated < n {
+		i := validated
+		if needsExec[i] {
+			incarnations[i]++
+			runOne(b.txs[i])
+		}
+
+		valid := true
+		if rs, _, ok := readWriteSetOf(results[i]); ok {
+			for key, version := range rs {
+				if latest, ok := mem.read(key, i); ok {
+					if latest != version {
+						valid = false
+						break
+					}
+				} else if version.txIndex >= 0 {
+					valid = false
+					break
+				}
+			}
+		}
+		if !valid {
+			// mark this tx and every higher index as needing re-execution.
+			for j := i; j < n; j++ {
+				needsExec[j] = true
+			}
+			continue
+		}
+
+		if err := confirm(results[i]); err != nil {
+			return err, results[i].txReq.txIndex
+		}
+		validated++
+	}
+	return nil, 0
+}
+
+// Execute dispatches a block's transactions through the scheduling strategy
+// configured by SetExecutionMode.
+func Execute(all []*PEVMTxRequest, dag types.TxDAG, execute func(*PEVMTxRequest) *PEVMTxResult, confirm func(*PEVMTxResult) error) (error, int) {
+	if CurrentExecutionMode() == ModeBlockSTM {
+		return NewBlockSTM(all).Run(execute, confirm)
+	}
+	return NewTxLevels(all, dag).Run(execute, confirm)
+}
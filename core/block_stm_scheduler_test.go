@@ -0,0 +1,153 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// rwSets holds the read/write set BlockSTM should observe for a given
+// *PEVMTxResult, since PEVMTxResult's real fields are defined outside this
+// package snapshot and this test can only attach new methods to it, not new
+// fields.
+var rwSets = map[*PEVMTxResult]struct {
+	read  ReadSet
+	write WriteSet
+}{}
+
+func (r *PEVMTxResult) ReadSet() ReadSet   { return rwSets[r].read }
+func (r *PEVMTxResult) WriteSet() WriteSet { return rwSets[r].write }
+
+// TestMVMemoryStaleIncarnationWriteIsRemoved is a focused regression test for
+// the bug where a re-executed incarnation that stops writing a key left the
+// previous incarnation's write to that key observable by later reads.
+func TestMVMemoryStaleIncarnationWriteIsRemoved(t *testing.T) {
+	mem := newMVMemory()
+	key := mvKey{addr: common.Address{0x01}}
+
+	mem.write(key, mvVersion{txIndex: 0, incarnation: 0}, common.Hash{0xaa})
+	if v, ok := mem.read(key, 1); !ok || v.incarnation != 0 {
+		t.Fatalf("expected incarnation 0's write to be visible, got %+v, %v", v, ok)
+	}
+
+	// tx 0 is re-executed at incarnation 1 and no longer writes key.
+	mem.remove(key, 0)
+	if _, ok := mem.read(key, 1); ok {
+		t.Fatal("stale incarnation's write is still visible after remove")
+	}
+}
+
+// TestMVMemoryReadPicksHighestIndexRegardlessOfWriteOrder exercises 3 writers
+// to the same key whose writes land out of txIndex order (as concurrent
+// workers can finish in any order), and checks read returns the entry with
+// the highest txIndex below the query, not whichever entry happened to be
+// appended last.
+func TestMVMemoryReadPicksHighestIndexRegardlessOfWriteOrder(t *testing.T) {
+	mem := newMVMemory()
+	key := mvKey{addr: common.Address{0x02}}
+
+	// completion order: tx 5, then tx 1, then tx 3 - none sorted by txIndex.
+	mem.write(key, mvVersion{txIndex: 5, incarnation: 0}, common.Hash{0x05})
+	mem.write(key, mvVersion{txIndex: 1, incarnation: 0}, common.Hash{0x01})
+	mem.write(key, mvVersion{txIndex: 3, incarnation: 0}, common.Hash{0x03})
+
+	v, ok := mem.read(key, 4)
+	if !ok {
+		t.Fatal("expected a write below txIndex 4")
+	}
+	if v.txIndex != 3 {
+		t.Fatalf("expected the highest writer below 4 (tx 3), got tx %d", v.txIndex)
+	}
+
+	v, ok = mem.read(key, 6)
+	if !ok || v.txIndex != 5 {
+		t.Fatalf("expected tx 5 (the highest writer below 6), got %+v, %v", v, ok)
+	}
+
+	v, ok = mem.read(key, 1)
+	if ok {
+		t.Fatalf("expected no writer below txIndex 1, got %+v", v)
+	}
+}
+
+// TestBlockSTMRerunsOnConflictAndMatchesSequentialResult forces tx 1 to read
+// a stale (pre-commit) version of a key tx 0 writes on its first speculative
+// pass, then checks the validator reruns tx 1 until its read matches tx 0's
+// committed write, and that an unrelated tx 2 is unaffected.
+func TestBlockSTMRerunsOnConflictAndMatchesSequentialResult(t *testing.T) {
+	key0 := mvKey{addr: common.Address{0x01}}
+	key1 := mvKey{addr: common.Address{0x02}}
+	key2 := mvKey{addr: common.Address{0x03}}
+
+	reqs := []*PEVMTxRequest{
+		{txIndex: 0},
+		{txIndex: 1},
+		{txIndex: 2},
+	}
+	incarnationsSeen := make([]int, len(reqs))
+
+	execute := func(tx *PEVMTxRequest) *PEVMTxResult {
+		res := &PEVMTxResult{txReq: tx}
+		incarnation := incarnationsSeen[tx.txIndex]
+		incarnationsSeen[tx.txIndex]++
+
+		switch tx.txIndex {
+		case 0:
+			rwSets[res] = struct {
+				read  ReadSet
+				write WriteSet
+			}{write: WriteSet{key0: common.Hash{0x01}}}
+		case 1:
+			if incarnation == 0 {
+				// speculative first pass: claims to have observed nothing for
+				// key0, which tx 0's committed write will contradict.
+				rwSets[res] = struct {
+					read  ReadSet
+					write WriteSet
+				}{
+					read:  ReadSet{key0: mvVersion{txIndex: -1}},
+					write: WriteSet{key1: common.Hash{0xff}},
+				}
+			} else {
+				// rerun: now observes tx 0's actual committed version.
+				rwSets[res] = struct {
+					read  ReadSet
+					write WriteSet
+				}{
+					read:  ReadSet{key0: mvVersion{txIndex: 0, incarnation: 0}},
+					write: WriteSet{key1: common.Hash{0x02}},
+				}
+			}
+		case 2:
+			rwSets[res] = struct {
+				read  ReadSet
+				write WriteSet
+			}{write: WriteSet{key2: common.Hash{0x03}}}
+		}
+		return res
+	}
+
+	committed := make(map[mvKey]common.Hash)
+	confirm := func(res *PEVMTxResult) error {
+		for key, value := range res.WriteSet() {
+			committed[key] = value
+		}
+		return nil
+	}
+
+	if err, _ := NewBlockSTM(reqs).Run(execute, confirm); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if incarnationsSeen[1] < 2 {
+		t.Fatalf("expected tx 1 to be re-executed after its stale read was detected, ran %d time(s)", incarnationsSeen[1])
+	}
+	if got := committed[key1]; got != (common.Hash{0x02}) {
+		t.Fatalf("tx 1 committed with a stale write: got %x, want the value its corrected rerun produced", got)
+	}
+	if got := committed[key0]; got != (common.Hash{0x01}) {
+		t.Fatalf("unexpected value for key0: got %x", got)
+	}
+	if got := committed[key2]; got != (common.Hash{0x03}) {
+		t.Fatalf("independent tx 2 should be unaffected by tx 1's conflict: got %x", got)
+	}
+}
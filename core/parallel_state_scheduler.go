@@ -3,7 +3,9 @@ package core
 import (
 	"fmt"
 	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -27,6 +29,44 @@ func ParallelNum() int {
 	return cap(runner)
 }
 
+// defaultParallelThreshold is the level size below which dispatching through
+// the worker pool costs more than it saves.
+const defaultParallelThreshold = 8
+
+var parallelThreshold int32 = defaultParallelThreshold
+
+// SetParallelThreshold configures the level size below which TxLevels.Run
+// executes a level inline on the calling goroutine instead of dispatching it
+// into the worker pool.
+func SetParallelThreshold(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt32(&parallelThreshold, int32(n))
+}
+
+// ParallelThreshold returns the threshold configured via SetParallelThreshold.
+func ParallelThreshold() int {
+	return int(atomic.LoadInt32(&parallelThreshold))
+}
+
+// TxCostEstimator estimates the relative execution cost of a transaction, used
+// by TxLevel.SplitByCost to balance work across chunks. It defaults to the
+// tx's gas limit.
+type TxCostEstimator func(tx *PEVMTxRequest) uint64
+
+var costEstimator TxCostEstimator = func(tx *PEVMTxRequest) uint64 {
+	return tx.msg.Gas
+}
+
+// SetCostEstimator overrides the per-tx cost estimator used by
+// TxLevel.SplitByCost. Passing nil is a no-op.
+func SetCostEstimator(f TxCostEstimator) {
+	if f != nil {
+		costEstimator = f
+	}
+}
+
 // TxLevel contains all transactions who are independent to each other
 type TxLevel []*PEVMTxRequest
 
@@ -73,6 +113,52 @@ func (tl TxLevel) Split(chunks int) []TxLevel {
 	return result
 }
 
+// SplitByCost splits tl into at most chunks TxLevels, balancing the estimated
+// cost of each chunk (see TxCostEstimator) rather than the tx count, so one
+// heavy tx does not stall a chunk while the other workers sit idle.
+func (tl TxLevel) SplitByCost(chunks int) []TxLevel {
+	if len(tl) == 0 {
+		return nil
+	}
+	if chunks <= 0 {
+		chunks = 1
+	}
+	if chunks > len(tl) {
+		chunks = len(tl)
+	}
+	costs := make([]uint64, len(tl))
+	var total uint64
+	for i, tx := range tl {
+		costs[i] = costEstimator(tx)
+		total += costs[i]
+	}
+	if total == 0 {
+		// nothing to balance by cost (e.g. the cost estimator isn't warmed up
+		// yet), fall back to an even split by tx count so the level still
+		// gets parallelized.
+		return tl.Split(chunks)
+	}
+	target := total / uint64(chunks)
+	if target == 0 {
+		target = 1
+	}
+	result := make([]TxLevel, 0, chunks)
+	var cur TxLevel
+	var curCost uint64
+	for i, tx := range tl {
+		cur = append(cur, tx)
+		curCost += costs[i]
+		if curCost >= target && len(result) < chunks-1 {
+			result = append(result, cur)
+			cur, curCost = nil, 0
+		}
+	}
+	if len(cur) > 0 {
+		result = append(result, cur)
+	}
+	return result
+}
+
 // TxLevels indicates the levels of transactions
 // the levels are ordered by the dependencies, and generated by the TxDAG
 type TxLevels []TxLevel
@@ -80,6 +166,60 @@ type TxLevels []TxLevel
 type confirmQueue struct {
 	queue     []confirmation
 	confirmed int // need to be set to -1 originally
+
+	// writers and learned back the dependencies discovered while confirming
+	// this block, for RunAndLearn. writers maps a touched key to the index of
+	// the last tx confirmed to have written it; learned maps a tx index that
+	// had to be rerun to the lower-indexed txs its stale read actually
+	// conflicted with.
+	writers map[depKey]int
+	learned map[int]types.TxDep
+}
+
+// recordWrites remembers, for every key in result's write set (see
+// readWriteSetOf), that i is the latest confirmed writer.
+func (cq *confirmQueue) recordWrites(i int, result *PEVMTxResult) {
+	_, ws, ok := readWriteSetOf(result)
+	if !ok {
+		return
+	}
+	if cq.writers == nil {
+		cq.writers = make(map[depKey]int)
+	}
+	for key := range ws {
+		cq.writers[depKey{addr: key.addr, slot: key.slot}] = i
+	}
+}
+
+// recordConflict looks at the stale result that is about to be rerun and, for
+// every key in its read set (see readWriteSetOf), checks whether a
+// lower-indexed tx has since written it. Any such tx is recorded as a real
+// dependency of i, to be handed to the installed TxDAGRecorder.
+func (cq *confirmQueue) recordConflict(i int) {
+	toConfirm := cq.queue[i]
+	if toConfirm.result == nil {
+		return
+	}
+	rs, _, ok := readWriteSetOf(toConfirm.result)
+	if !ok {
+		return
+	}
+	seen := make(map[int]bool)
+	var deps []uint64
+	for key := range rs {
+		if w, ok := cq.writers[depKey{addr: key.addr, slot: key.slot}]; ok && w < i && !seen[w] {
+			seen[w] = true
+			deps = append(deps, uint64(w))
+		}
+	}
+	if len(deps) == 0 {
+		return
+	}
+	sort.Slice(deps, func(a, b int) bool { return deps[a] < deps[b] })
+	if cq.learned == nil {
+		cq.learned = make(map[int]types.TxDep)
+	}
+	cq.learned[i] = types.TxDep{TxIndexes: deps}
 }
 
 type confirmation struct {
@@ -111,6 +251,7 @@ func (cq *confirmQueue) confirmWithTrust(level TxLevel, execute func(*PEVMTxRequ
 		}
 		switch true {
 		case toConfirm.executed != nil:
+			cq.recordConflict(i)
 			if err := cq.rerun(i, execute, confirm); err != nil {
 				// TODO add logs for err
 				// rerun failed, something very wrong.
@@ -121,11 +262,14 @@ func (cq *confirmQueue) confirmWithTrust(level TxLevel, execute func(*PEVMTxRequ
 			//try the first confirm
 			if err := confirm(toConfirm.result); err != nil {
 				// TODO add logs for err
+				cq.recordConflict(i)
 				if err = cq.rerun(i, execute, confirm); err != nil {
 					// TODO add logs for err
 					// rerun failed, something very wrong.
 					return err, toConfirm.result.txReq.txIndex
 				}
+			} else {
+				cq.recordWrites(i, toConfirm.result)
 			}
 		}
 		cq.confirmed = i
@@ -145,6 +289,7 @@ func (cq *confirmQueue) confirm(execute func(*PEVMTxRequest) *PEVMTxResult, conf
 		}
 		switch true {
 		case toConfirm.executed != nil:
+			cq.recordConflict(i)
 			if err := cq.rerun(i, execute, confirm); err != nil {
 				// TODO add logs for err
 				// rerun failed, something very wrong.
@@ -155,11 +300,14 @@ func (cq *confirmQueue) confirm(execute func(*PEVMTxRequest) *PEVMTxResult, conf
 			//try the first confirm
 			if err := confirm(toConfirm.result); err != nil {
 				// TODO add logs for err
+				cq.recordConflict(i)
 				if err = cq.rerun(i, execute, confirm); err != nil {
 					// TODO add logs for err
 					// rerun failed, something very wrong.
 					return err, toConfirm.result.txReq.txIndex
 				}
+			} else {
+				cq.recordWrites(i, toConfirm.result)
 			}
 		}
 		cq.confirmed = i
@@ -182,12 +330,31 @@ func (cq *confirmQueue) rerun(i int, execute func(*PEVMTxRequest) *PEVMTxResult,
 		// TODO add metrics, add error logs.
 		return cq.queue[i].confirmed
 	}
+	cq.recordWrites(i, rerun)
 	return nil
 }
 
 // run runs the transactions in parallel
 // execute must return a non-nil result, otherwise it panics.
 func (tls TxLevels) Run(execute func(*PEVMTxRequest) *PEVMTxResult, confirm func(*PEVMTxResult) error) (error, int) {
+	_, err, txIndex := tls.run(execute, confirm)
+	return err, txIndex
+}
+
+// RunAndLearn behaves like Run, but additionally feeds the dependencies
+// discovered while confirming this block (see confirmQueue.recordConflict)
+// into the TxDAGRecorder installed via SetTxDAGRecorder, if any, so a later
+// block with similar traffic can start from a tighter DAG (see
+// SuggestedTxDAG) than predictTxDAG's guess.
+func (tls TxLevels) RunAndLearn(block uint64, execute func(*PEVMTxRequest) *PEVMTxResult, confirm func(*PEVMTxResult) error) (error, int) {
+	toConfirm, err, txIndex := tls.run(execute, confirm)
+	if err == nil && txDAGRecorder != nil && len(toConfirm.learned) > 0 {
+		txDAGRecorder.Observe(block, learnedTxDAG(toConfirm.learned))
+	}
+	return err, txIndex
+}
+
+func (tls TxLevels) run(execute func(*PEVMTxRequest) *PEVMTxResult, confirm func(*PEVMTxResult) error) (*confirmQueue, error, int) {
 	toConfirm := &confirmQueue{
 		queue:     make([]confirmation, tls.txCount()),
 		confirmed: -1,
@@ -197,38 +364,46 @@ func (tls TxLevels) Run(execute func(*PEVMTxRequest) *PEVMTxResult, confirm func
 
 	// execute all transactions in parallel
 	for _, txLevel := range tls {
-		wait := sync.WaitGroup{}
-		trunks := txLevel.Split(runtime.NumCPU())
-		wait.Add(len(trunks))
-		// split tx into chunks, to save the cost of channel communication
-		for _, txs := range trunks {
-			// execute the transactions in parallel
-			temp := txs
-			run := func() {
-				for _, tx := range temp {
-					res := execute(tx)
-					toConfirm.collect(res)
+		if len(txLevel) < ParallelThreshold() {
+			// too small to be worth the channel + waitgroup overhead, run inline.
+			for _, tx := range txLevel {
+				res := execute(tx)
+				toConfirm.collect(res)
+			}
+		} else {
+			wait := sync.WaitGroup{}
+			trunks := txLevel.SplitByCost(runtime.NumCPU())
+			wait.Add(len(trunks))
+			// split tx into chunks, to save the cost of channel communication
+			for _, txs := range trunks {
+				// execute the transactions in parallel
+				temp := txs
+				run := func() {
+					for _, tx := range temp {
+						res := execute(tx)
+						toConfirm.collect(res)
+					}
+					wait.Done()
 				}
-				wait.Done()
+				//go run()
+				runner <- run
 			}
-			//go run()
-			runner <- run
+			wait.Wait()
 		}
-		wait.Wait()
 		// all transactions of current level are executed, now try to confirm.
 		if trustDAG {
 			if err, txIndex := toConfirm.confirmWithTrust(txLevel, execute, confirm); err != nil {
 				// something very wrong, stop the process
-				return err, txIndex
+				return toConfirm, err, txIndex
 			}
 		} else {
 			if err, txIndex := toConfirm.confirm(execute, confirm); err != nil {
 				// something very wrong, stop the process
-				return err, txIndex
+				return toConfirm, err, txIndex
 			}
 		}
 	}
-	return nil, 0
+	return toConfirm, nil, 0
 }
 
 func (tls TxLevels) txCount() int {
@@ -239,31 +414,72 @@ func (tls TxLevels) txCount() int {
 	return count
 }
 
-// predictTxDAG predicts the TxDAG by their from address and to address, and generates the levels of transactions
+// depKey identifies a single address or, when slot is non-zero, a single
+// storage slot of that address, for the purpose of dependency prediction.
+type depKey struct {
+	addr common.Address
+	slot common.Hash
+}
+
+// AccessHinter predicts the storage slots a legacy transaction (one with no
+// EIP-2930 access list) is likely to touch, based on a prior simulation or a
+// persistent per-contract heuristic cache. It lets a caller (e.g. the miner)
+// sharpen predictTxDAG for txs that don't declare their own access list.
+type AccessHinter interface {
+	Hint(tx *PEVMTxRequest) types.AccessList
+}
+
+var accessHinter AccessHinter
+
+// SetAccessHinter installs the AccessHinter consulted by predictTxDAG for
+// transactions without an access list. Passing nil disables hinting.
+func SetAccessHinter(h AccessHinter) {
+	accessHinter = h
+}
+
+// touchedKeys returns every address/slot tx's execution is predicted to
+// touch: its from and to address, the addresses and slots named in its
+// EIP-2930 access list, and, for txs without one, whatever the installed
+// AccessHinter predicts.
+func touchedKeys(tx *PEVMTxRequest) []depKey {
+	keys := make([]depKey, 0, 2)
+	keys = append(keys, depKey{addr: tx.msg.From})
+	if tx.msg.To != nil {
+		keys = append(keys, depKey{addr: *tx.msg.To})
+	}
+	al := tx.msg.AccessList
+	if len(al) == 0 && accessHinter != nil {
+		al = accessHinter.Hint(tx)
+	}
+	for _, tuple := range al {
+		keys = append(keys, depKey{addr: tuple.Address})
+		for _, slot := range tuple.StorageKeys {
+			keys = append(keys, depKey{addr: tuple.Address, slot: slot})
+		}
+	}
+	return keys
+}
+
+// predictTxDAG predicts the TxDAG by the addresses and storage slots each tx
+// is expected to touch, and generates the levels of transactions
 func (tl TxLevel) predictTxDAG(dag types.TxDAG) {
-	marked := make(map[common.Address]int, len(tl))
+	marked := make(map[depKey]int, len(tl)*2)
 	for _, tx := range tl {
+		keys := touchedKeys(tx)
+		seen := make(map[int]bool, len(keys))
 		var deps []uint64
-		var tfrom, tto = -1, -1
-		if ti, ok := marked[tx.msg.From]; ok {
-			tfrom = ti
-		}
-		if ti, ok := marked[*tx.msg.To]; ok {
-			tto = ti
-		}
-		if tfrom >= 0 && tto >= 0 && tfrom > tto {
-			// keep deps ordered by the txIndex
-			tfrom, tto = tto, tfrom
-		}
-		if tfrom >= 0 {
-			deps = append(deps, uint64(tfrom))
-		}
-		if tto >= 0 {
-			deps = append(deps, uint64(tto))
+		for _, key := range keys {
+			if ti, ok := marked[key]; ok && !seen[ti] {
+				seen[ti] = true
+				deps = append(deps, uint64(ti))
+			}
 		}
+		// keep deps ordered by the txIndex
+		sort.Slice(deps, func(i, j int) bool { return deps[i] < deps[j] })
 		dag.SetTxDep(tx.txIndex, types.TxDep{TxIndexes: deps})
-		marked[tx.msg.From] = tx.txIndex
-		marked[*tx.msg.To] = tx.txIndex
+		for _, key := range keys {
+			marked[key] = tx.txIndex
+		}
 	}
 }
 
@@ -330,3 +546,47 @@ func NewTxLevels(all []*PEVMTxRequest, dag types.TxDAG) TxLevels {
 	}
 	return levels
 }
+
+// TxDAGRecorder lets the scheduler learn the real dependencies discovered
+// while confirming a block (see confirmQueue.recordConflict) and suggest a
+// tighter starting TxDAG for a later block with similar traffic, gradually
+// correcting predictTxDAG's coarse from/to/access-list guess.
+type TxDAGRecorder interface {
+	// Observe records the dependencies actually exercised while confirming block.
+	Observe(block uint64, dag types.TxDAG)
+	// Suggest returns a predicted TxDAG for txs based on previously observed
+	// blocks, or nil if nothing useful has been learned yet.
+	Suggest(txs []*PEVMTxRequest) types.TxDAG
+}
+
+var txDAGRecorder TxDAGRecorder
+
+// SetTxDAGRecorder installs the recorder used by TxLevels.RunAndLearn and
+// consulted by the miner/importer via SuggestedTxDAG. Passing nil disables
+// learning.
+func SetTxDAGRecorder(r TxDAGRecorder) {
+	txDAGRecorder = r
+}
+
+// SuggestedTxDAG forwards to the installed TxDAGRecorder's Suggest, or
+// returns nil if none is installed.
+func SuggestedTxDAG(txs []*PEVMTxRequest) types.TxDAG {
+	if txDAGRecorder == nil {
+		return nil
+	}
+	return txDAGRecorder.Suggest(txs)
+}
+
+// learnedTxDAG is the concrete types.TxDAG handed to TxDAGRecorder.Observe.
+type learnedTxDAG map[int]types.TxDep
+
+func (d learnedTxDAG) TxDep(i int) *types.TxDep {
+	if dep, ok := d[i]; ok {
+		return &dep
+	}
+	return nil
+}
+
+func (d learnedTxDAG) SetTxDep(i int, dep types.TxDep) {
+	d[i] = dep
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestConfirmQueueRecordsConflictThroughRWSetCapturer exercises
+// recordWrites/recordConflict end to end through the installed
+// RWSetCapturer (see readWriteSetOf), confirming that a tx whose read set
+// overlaps a lower-indexed tx's write set is recorded as depending on it,
+// and that an unrelated tx is not.
+func TestConfirmQueueRecordsConflictThroughRWSetCapturer(t *testing.T) {
+	defer SetRWSetCapturer(nil)
+
+	key0 := mvKey{addr: common.Address{0x01}}
+	key1 := mvKey{addr: common.Address{0x02}}
+	// key2 is read by tx 2 and written by no tx.
+	key2 := mvKey{addr: common.Address{0x03}}
+
+	rwSets := map[int]struct {
+		rs ReadSet
+		ws WriteSet
+	}{
+		0: {ws: WriteSet{key0: common.Hash{0xaa}}},
+		1: {rs: ReadSet{key0: mvVersion{txIndex: 0}}, ws: WriteSet{key1: common.Hash{0xbb}}},
+		2: {rs: ReadSet{key2: mvVersion{txIndex: -1}}},
+	}
+	SetRWSetCapturer(func(res *PEVMTxResult) (ReadSet, WriteSet, bool) {
+		rw, ok := rwSets[res.txReq.txIndex]
+		if !ok {
+			return nil, nil, false
+		}
+		return rw.rs, rw.ws, true
+	})
+
+	cq := &confirmQueue{queue: make([]confirmation, 3), confirmed: -1}
+	for i := 0; i < 3; i++ {
+		cq.queue[i].result = &PEVMTxResult{txReq: &PEVMTxRequest{txIndex: i}}
+	}
+
+	// tx 0 commits first, so its write to key0 is recorded.
+	cq.recordWrites(0, cq.queue[0].result)
+	// tx 1 is about to be rerun; its read set overlaps tx 0's recorded write.
+	cq.recordConflict(1)
+	cq.recordWrites(1, cq.queue[1].result)
+	// tx 2's read set doesn't overlap any recorded writer.
+	cq.recordConflict(2)
+
+	if dep, ok := cq.learned[1]; !ok || !reflect.DeepEqual(dep.TxIndexes, []uint64{0}) {
+		t.Fatalf("tx 1 should be learned as depending on tx 0, got %+v, %v", dep, ok)
+	}
+	if _, ok := cq.learned[2]; ok {
+		t.Fatalf("tx 2 has no overlapping writer and should not be learned as depending on anything, got %+v", cq.learned[2])
+	}
+}
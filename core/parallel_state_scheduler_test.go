@@ -0,0 +1,166 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeAccessHinter returns a fixed AccessList for every tx, regardless of
+// index, so tests can isolate the "no access list -> fall back to hinter"
+// branch of touchedKeys from the "has one of its own" branch.
+type fakeAccessHinter struct {
+	hint types.AccessList
+}
+
+func (h fakeAccessHinter) Hint(tx *PEVMTxRequest) types.AccessList { return h.hint }
+
+func TestTouchedKeysUnionsFromToAndAccessList(t *testing.T) {
+	from := common.Address{0x01}
+	to := common.Address{0x02}
+	slot := common.Hash{0x03}
+	alAddr := common.Address{0x04}
+
+	tx := &PEVMTxRequest{
+		txIndex: 0,
+		msg: Message{
+			From: from,
+			To:   &to,
+			AccessList: types.AccessList{
+				{Address: alAddr, StorageKeys: []common.Hash{slot}},
+			},
+		},
+	}
+
+	got := touchedKeys(tx)
+	want := []depKey{
+		{addr: from},
+		{addr: to},
+		{addr: alAddr},
+		{addr: alAddr, slot: slot},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("touchedKeys with from/to/access-list:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTouchedKeysFallsBackToHinterWhenNoAccessList(t *testing.T) {
+	defer SetAccessHinter(nil)
+
+	from := common.Address{0x01}
+	hintAddr := common.Address{0x05}
+	SetAccessHinter(fakeAccessHinter{hint: types.AccessList{{Address: hintAddr}}})
+
+	tx := &PEVMTxRequest{txIndex: 0, msg: Message{From: from}}
+	got := touchedKeys(tx)
+	want := []depKey{{addr: from}, {addr: hintAddr}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("touchedKeys should fall back to the installed hinter:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTouchedKeysIgnoresHinterWhenOwnAccessListPresent(t *testing.T) {
+	defer SetAccessHinter(nil)
+
+	from := common.Address{0x01}
+	ownAddr := common.Address{0x06}
+	hintAddr := common.Address{0x07}
+	SetAccessHinter(fakeAccessHinter{hint: types.AccessList{{Address: hintAddr}}})
+
+	tx := &PEVMTxRequest{
+		txIndex: 0,
+		msg: Message{
+			From:       from,
+			AccessList: types.AccessList{{Address: ownAddr}},
+		},
+	}
+	got := touchedKeys(tx)
+	want := []depKey{{addr: from}, {addr: ownAddr}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("touchedKeys should prefer the tx's own access list over the hinter:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+// TestPredictTxDAGDependsOnLastWriterOfSharedKey checks that two txs touching
+// the same address are linked in the predicted DAG, and a third independent
+// tx is not.
+func TestPredictTxDAGDependsOnLastWriterOfSharedKey(t *testing.T) {
+	shared := common.Address{0x09}
+	other := common.Address{0x0a}
+
+	tl := TxLevel{
+		{txIndex: 0, msg: Message{From: shared}},
+		{txIndex: 1, msg: Message{From: shared}},
+		{txIndex: 2, msg: Message{From: other}},
+	}
+	dag := make(learnedTxDAG)
+	tl.predictTxDAG(dag)
+
+	if dep := dag.TxDep(1); dep == nil || !reflect.DeepEqual(dep.TxIndexes, []uint64{0}) {
+		t.Fatalf("tx 1 should depend on tx 0 for the shared address, got %+v", dep)
+	}
+	if dep := dag.TxDep(2); dep != nil && len(dep.TxIndexes) != 0 {
+		t.Fatalf("independent tx 2 should have no dependencies, got %+v", dep)
+	}
+}
+
+func TestSplitByCostBalancesByEstimatedCost(t *testing.T) {
+	orig := costEstimator
+	defer func() { costEstimator = orig }()
+
+	// costs keyed by txIndex, bypassing tx.msg entirely. tx 0 alone outweighs
+	// the other three combined, so a cost-balanced split must isolate it
+	// rather than splitting evenly by count.
+	costs := map[int]uint64{0: 7, 1: 1, 2: 1, 3: 1}
+	SetCostEstimator(func(tx *PEVMTxRequest) uint64 { return costs[tx.txIndex] })
+
+	tl := make(TxLevel, 4)
+	for i := range tl {
+		tl[i] = &PEVMTxRequest{txIndex: i}
+	}
+
+	chunks := tl.SplitByCost(2)
+	// every tx must appear exactly once, across all chunks, in order.
+	var gotIndexes []int
+	for _, chunk := range chunks {
+		for _, tx := range chunk {
+			gotIndexes = append(gotIndexes, tx.txIndex)
+		}
+	}
+	wantIndexes := []int{0, 1, 2, 3}
+	if !reflect.DeepEqual(gotIndexes, wantIndexes) {
+		t.Fatalf("SplitByCost must preserve every tx exactly once in order: got %v, want %v", gotIndexes, wantIndexes)
+	}
+	if len(chunks) != 2 || len(chunks[0]) != 1 || len(chunks[1]) != 3 {
+		t.Fatalf("expected the heavy tx 0 isolated into its own chunk (1/3 split), got chunk sizes %v", chunkSizes(chunks))
+	}
+}
+
+func chunkSizes(chunks []TxLevel) []int {
+	sizes := make([]int, len(chunks))
+	for i, c := range chunks {
+		sizes[i] = len(c)
+	}
+	return sizes
+}
+
+func TestSplitByCostFallsBackToEvenSplitWhenTotalCostIsZero(t *testing.T) {
+	orig := costEstimator
+	defer func() { costEstimator = orig }()
+	SetCostEstimator(func(tx *PEVMTxRequest) uint64 { return 0 })
+
+	tl := make(TxLevel, 4)
+	for i := range tl {
+		tl[i] = &PEVMTxRequest{txIndex: i}
+	}
+
+	chunks := tl.SplitByCost(2)
+	if len(chunks) != 2 {
+		t.Fatalf("expected an even 2-way split when every cost is zero, got %d chunks", len(chunks))
+	}
+	if len(chunks[0]) != 2 || len(chunks[1]) != 2 {
+		t.Fatalf("expected a 2/2 split, got %d/%d", len(chunks[0]), len(chunks[1]))
+	}
+}
@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func genBatchVerifyPairs(t *testing.T, n int) []struct {
+	PubKey PublicKey
+	Msg    []byte
+	Sig    Signature
+} {
+	pairs := make([]struct {
+		PubKey PublicKey
+		Msg    []byte
+		Sig    Signature
+	}, n)
+	for i := range pairs {
+		sk, err := RandKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("RandKey: %v", err)
+		}
+		msg := make([]byte, 32)
+		msg[0] = byte(i + 1)
+		pairs[i].PubKey = sk.PublicKey()
+		pairs[i].Msg = msg
+		pairs[i].Sig = sk.Sign(msg)
+	}
+	return pairs
+}
+
+func TestBatchVerifyValid(t *testing.T) {
+	pairs := genBatchVerifyPairs(t, 8)
+	if !BatchVerify(pairs) {
+		t.Fatal("expected a valid batch to verify")
+	}
+}
+
+func TestBatchVerifyRejectsDuplicateMessage(t *testing.T) {
+	pairs := genBatchVerifyPairs(t, 2)
+	pairs[1].Msg = pairs[0].Msg
+	if BatchVerify(pairs) {
+		t.Fatal("expected a batch with a duplicate message to be rejected")
+	}
+}
+
+func TestBatchVerifyRejectsNon32ByteMessage(t *testing.T) {
+	pairs := genBatchVerifyPairs(t, 2)
+	// differs from pairs[0].Msg only after byte 32: as a full byte string it
+	// is distinct, but copy(msgs[i][:], p.Msg) would truncate both to the
+	// same 32-byte value fed to AggregateVerify.
+	pairs[1].Msg = append(append([]byte{}, pairs[0].Msg...), 0x01)
+	if BatchVerify(pairs) {
+		t.Fatal("expected a message that isn't exactly 32 bytes to be rejected")
+	}
+}
+
+func FuzzBatchVerify(f *testing.F) {
+	f.Add(3, 1)
+	f.Fuzz(func(t *testing.T, n int, corruptIdx int) {
+		if n < 1 || n > 16 {
+			t.Skip()
+		}
+		pairs := genBatchVerifyPairs(t, n)
+		if !BatchVerify(pairs) {
+			t.Fatal("unmodified batch should verify")
+		}
+		idx := ((corruptIdx % n) + n) % n
+		corrupted := make([]byte, len(pairs[idx].Msg))
+		copy(corrupted, pairs[idx].Msg)
+		corrupted[0] ^= 0xff
+		if bytes.Equal(corrupted, pairs[idx].Msg) {
+			t.Skip()
+		}
+		pairs[idx].Msg = corrupted
+		if BatchVerify(pairs) {
+			t.Fatal("batch with one corrupted pair must not verify")
+		}
+	})
+}
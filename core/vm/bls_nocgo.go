@@ -7,7 +7,9 @@
 package vm
 
 import (
+	"crypto/rand"
 	"io"
+	"math/big"
 	"time"
 
 	"github.com/karlseguin/ccache"
@@ -242,3 +244,104 @@ func (p *publicKey) IsInfinite() bool {
 func (p *publicKey) Equals(p2 PublicKey) bool {
 	panic("not support Equals")
 }
+
+// BatchVerify verifies many (pubkey, msg, sig) triples at once using a random
+// linear combination: it samples a random 128-bit scalar r_i per pair, scales
+// sig_i and pubKey_i by r_i, and checks the resulting aggregate with a single
+// AggregateVerify rather than len(pairs) separate pairings. Messages (and
+// pubkey/msg pairs) must be distinct, since a duplicate reopens the rogue-
+// signature attack the per-pair scaling is meant to close.
+func BatchVerify(pairs []struct {
+	PubKey PublicKey
+	Msg    []byte
+	Sig    Signature
+}) bool {
+	if len(pairs) == 0 {
+		return false
+	}
+	// A repeated message lets two different signers' pairs cancel out in the
+	// aggregate equation by bilinearity, regardless of their pubkeys, so the
+	// message actually fed to AggregateVerify below - the 32-byte form, not
+	// the full p.Msg - must be unique across the batch. Reject anything that
+	// wouldn't copy into msgs faithfully, so the dedup key and the verified
+	// message can never diverge.
+	seen := make(map[[32]byte]bool, len(pairs))
+	for _, p := range pairs {
+		if len(p.Msg) != 32 {
+			return false
+		}
+		var key [32]byte
+		copy(key[:], p.Msg)
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+	}
+
+	scaledSigs := make([]Signature, len(pairs))
+	scaledPubKeys := make([]PublicKey, len(pairs))
+	msgs := make([][32]byte, len(pairs))
+	for i, p := range pairs {
+		r, err := randomBatchScalar()
+		if err != nil {
+			return false
+		}
+		scaledSigs[i] = scalarMulSignature(p.Sig, r)
+		scaledPubKeys[i] = scalarMulPublicKey(p.PubKey, r)
+		copy(msgs[i][:], p.Msg)
+	}
+	return AggregateSignatures(scaledSigs).AggregateVerify(scaledPubKeys, msgs)
+}
+
+// randomBatchScalar samples a non-zero random 128-bit scalar for BatchVerify.
+func randomBatchScalar() (*big.Int, error) {
+	buf := make([]byte, 16)
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		if r := new(big.Int).SetBytes(buf); r.Sign() != 0 {
+			return r, nil
+		}
+	}
+}
+
+// scalarMulSignature computes scalar*sig via double-and-add, using signature
+// addition (AggregateSignatures) as the only group operation.
+func scalarMulSignature(sig Signature, scalar *big.Int) Signature {
+	var result Signature
+	base := sig
+	for i := 0; i < scalar.BitLen(); i++ {
+		if scalar.Bit(i) == 1 {
+			if result == nil {
+				result = base
+			} else {
+				result = AggregateSignatures([]Signature{result, base})
+			}
+		}
+		if i != scalar.BitLen()-1 {
+			base = AggregateSignatures([]Signature{base, base})
+		}
+	}
+	return result
+}
+
+// scalarMulPublicKey computes scalar*pubKey via double-and-add, using public
+// key aggregation (PublicKey.Aggregate) as the only group operation.
+func scalarMulPublicKey(pubKey PublicKey, scalar *big.Int) PublicKey {
+	var result PublicKey
+	base := pubKey
+	for i := 0; i < scalar.BitLen(); i++ {
+		if scalar.Bit(i) == 1 {
+			if result == nil {
+				result = base
+			} else {
+				result = result.Aggregate(base)
+			}
+		}
+		if i != scalar.BitLen()-1 {
+			base = base.Aggregate(base)
+		}
+	}
+	return result
+}
@@ -0,0 +1,358 @@
+package vm
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	kbls "github.com/kilic/bls12-381"
+)
+
+// PrecompiledContract is the basic interface for native Go contracts. The
+// implementation requires a deterministic gas count based on the input size
+// of the Run method of the contract.
+type PrecompiledContract interface {
+	RequiredGas(input []byte) uint64
+	Run(input []byte) ([]byte, error)
+}
+
+// EIP-2537 gas schedule, in gas per precompile call.
+const (
+	bls12381G1AddGas          uint64 = 375
+	bls12381G1MulGas          uint64 = 12000
+	bls12381G2AddGas          uint64 = 600
+	bls12381G2MulGas          uint64 = 22500
+	bls12381PairingBaseGas    uint64 = 37700
+	bls12381PairingPerPairGas uint64 = 32600
+	bls12381MapG1Gas          uint64 = 5500
+	bls12381MapG2Gas          uint64 = 23800
+)
+
+// bls12381MultiExpDiscountTable is the EIP-2537 MSM discount table, indexed
+// by (k-1) where k is the number of (point, scalar) pairs in the input, up
+// to the max discount at k=128. The discount is expressed per mille.
+var bls12381MultiExpDiscountTable = [128]uint64{
+	1000, 949, 848, 797, 764, 750, 738, 728, 719, 712, 705, 698, 692, 687, 682, 677,
+	673, 669, 665, 661, 658, 654, 651, 648, 645, 642, 640, 637, 635, 632, 630, 627,
+	625, 623, 621, 619, 617, 615, 613, 611, 609, 608, 606, 604, 603, 601, 599, 598,
+	596, 595, 593, 592, 591, 589, 588, 586, 585, 584, 582, 581, 580, 579, 577, 576,
+	575, 574, 573, 572, 570, 569, 568, 567, 566, 565, 564, 563, 562, 561, 560, 559,
+	558, 557, 556, 555, 554, 553, 552, 551, 550, 549, 548, 547, 547, 546, 545, 544,
+	543, 542, 541, 540, 539, 538, 537, 536, 536, 535, 534, 533, 532, 531, 531, 530,
+	529, 528, 527, 526, 526, 525, 524, 523, 522, 522, 521, 520, 519, 518, 518, 517,
+}
+
+const bls12381MultiExpDiscountDenom = 1000
+
+var (
+	errBLS12381InvalidInputLength          = errors.New("invalid input length")
+	errBLS12381InvalidFieldElementTopBytes = errors.New("invalid field element top bytes")
+	errBLS12381G1PointSubgroup             = errors.New("g1 point is not on correct subgroup")
+	errBLS12381G2PointSubgroup             = errors.New("g2 point is not on correct subgroup")
+)
+
+// PrecompiledContractsPrague adds the EIP-2537 BLS12-381 precompiles to the
+// addresses reserved for them.
+var PrecompiledContractsPrague = map[common.Address]PrecompiledContract{
+	common.BytesToAddress([]byte{0x0b}): &bls12381G1Add{},
+	common.BytesToAddress([]byte{0x0c}): &bls12381G1Msm{},
+	common.BytesToAddress([]byte{0x0d}): &bls12381G2Add{},
+	common.BytesToAddress([]byte{0x0e}): &bls12381G2Msm{},
+	common.BytesToAddress([]byte{0x0f}): &bls12381Pairing{},
+	common.BytesToAddress([]byte{0x10}): &bls12381MapFpToG1{},
+	common.BytesToAddress([]byte{0x11}): &bls12381MapFp2ToG2{},
+}
+
+// fpLen is the byte length of an EIP-2537 encoded Fp element (16 bytes of
+// zero padding followed by the 48-byte big-endian value).
+const fpLen = 64
+
+// decodeBLS12381FieldElement decodes a padded Fp element, rejecting any
+// non-zero padding byte.
+func decodeBLS12381FieldElement(in []byte) ([]byte, error) {
+	if len(in) != fpLen {
+		return nil, errBLS12381InvalidInputLength
+	}
+	for _, b := range in[:16] {
+		if b != 0 {
+			return nil, errBLS12381InvalidFieldElementTopBytes
+		}
+	}
+	return in[16:], nil
+}
+
+func decodeBLS12381G1Point(in []byte) (*kbls.PointG1, error) {
+	if len(in) != 128 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	x, err := decodeBLS12381FieldElement(in[:64])
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBLS12381FieldElement(in[64:])
+	if err != nil {
+		return nil, err
+	}
+	g1 := kbls.NewG1()
+	p, err := g1.FromBytes(append(x, y...))
+	if err != nil {
+		return nil, err
+	}
+	if !g1.InCorrectSubgroup(p) {
+		return nil, errBLS12381G1PointSubgroup
+	}
+	return p, nil
+}
+
+func encodeBLS12381G1Point(p *kbls.PointG1) []byte {
+	out := make([]byte, 128)
+	raw := kbls.NewG1().ToBytes(p)
+	copy(out[16:64], raw[:48])
+	copy(out[80:128], raw[48:])
+	return out
+}
+
+func decodeBLS12381G2Point(in []byte) (*kbls.PointG2, error) {
+	if len(in) != 256 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	c0, err := decodeBLS12381FieldElement(in[:64])
+	if err != nil {
+		return nil, err
+	}
+	c1, err := decodeBLS12381FieldElement(in[64:128])
+	if err != nil {
+		return nil, err
+	}
+	c2, err := decodeBLS12381FieldElement(in[128:192])
+	if err != nil {
+		return nil, err
+	}
+	c3, err := decodeBLS12381FieldElement(in[192:])
+	if err != nil {
+		return nil, err
+	}
+	g2 := kbls.NewG2()
+	// the curve point encodes two Fp2 elements (x, y), each itself a pair of
+	// Fp elements, ordered (c0, c1) in the EIP-2537 encoding but (c1, c0) in
+	// the order kbls's FromBytes reads, so each pair is swapped. c0..c3 are
+	// un-copied sub-slices of in sharing one backing array, each with spare
+	// capacity reaching into the next field's bytes, so appending them
+	// in-place (e.g. appending c0 onto c1) would overwrite c2/c3 before they
+	// are read; copy into a freshly allocated buffer instead.
+	raw := make([]byte, 0, 192)
+	raw = append(raw, c1...)
+	raw = append(raw, c0...)
+	raw = append(raw, c3...)
+	raw = append(raw, c2...)
+	p, err := g2.FromBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !g2.InCorrectSubgroup(p) {
+		return nil, errBLS12381G2PointSubgroup
+	}
+	return p, nil
+}
+
+func encodeBLS12381G2Point(p *kbls.PointG2) []byte {
+	out := make([]byte, 256)
+	raw := kbls.NewG2().ToBytes(p)
+	// raw is (x_c1, x_c0, y_c1, y_c0), each 48 bytes; EIP-2537 wants
+	// (x_c0, x_c1, y_c0, y_c1), each padded to 64 bytes.
+	copy(out[16:64], raw[48:96])
+	copy(out[80:128], raw[:48])
+	copy(out[144:192], raw[144:192])
+	copy(out[208:256], raw[96:144])
+	return out
+}
+
+func bls12381MSMGas(pairs int, perPointGas uint64) uint64 {
+	if pairs == 0 {
+		return 0
+	}
+	discount := bls12381MultiExpDiscountTable[len(bls12381MultiExpDiscountTable)-1]
+	if pairs <= len(bls12381MultiExpDiscountTable) {
+		discount = bls12381MultiExpDiscountTable[pairs-1]
+	}
+	return uint64(pairs) * perPointGas * discount / bls12381MultiExpDiscountDenom
+}
+
+// bls12381G1Add implements the BLS12_G1ADD precompile.
+type bls12381G1Add struct{}
+
+func (c *bls12381G1Add) RequiredGas(input []byte) uint64 {
+	return bls12381G1AddGas
+}
+
+func (c *bls12381G1Add) Run(input []byte) ([]byte, error) {
+	if len(input) != 256 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	p0, err := decodeBLS12381G1Point(input[:128])
+	if err != nil {
+		return nil, err
+	}
+	p1, err := decodeBLS12381G1Point(input[128:])
+	if err != nil {
+		return nil, err
+	}
+	g1 := kbls.NewG1()
+	r := g1.New()
+	g1.Add(r, p0, p1)
+	return encodeBLS12381G1Point(r), nil
+}
+
+// bls12381G1Msm implements the BLS12_G1MSM precompile.
+type bls12381G1Msm struct{}
+
+func (c *bls12381G1Msm) RequiredGas(input []byte) uint64 {
+	return bls12381MSMGas(len(input)/160, bls12381G1MulGas)
+}
+
+func (c *bls12381G1Msm) Run(input []byte) ([]byte, error) {
+	if len(input) == 0 || len(input)%160 != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	g1 := kbls.NewG1()
+	acc := g1.Zero()
+	for i := 0; i < len(input); i += 160 {
+		p, err := decodeBLS12381G1Point(input[i : i+128])
+		if err != nil {
+			return nil, err
+		}
+		scalar := new(kbls.Fr).FromBytes(input[i+128 : i+160])
+		term := g1.New()
+		g1.MulScalar(term, p, scalar)
+		g1.Add(acc, acc, term)
+	}
+	return encodeBLS12381G1Point(acc), nil
+}
+
+// bls12381G2Add implements the BLS12_G2ADD precompile.
+type bls12381G2Add struct{}
+
+func (c *bls12381G2Add) RequiredGas(input []byte) uint64 {
+	return bls12381G2AddGas
+}
+
+func (c *bls12381G2Add) Run(input []byte) ([]byte, error) {
+	if len(input) != 512 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	p0, err := decodeBLS12381G2Point(input[:256])
+	if err != nil {
+		return nil, err
+	}
+	p1, err := decodeBLS12381G2Point(input[256:])
+	if err != nil {
+		return nil, err
+	}
+	g2 := kbls.NewG2()
+	r := g2.New()
+	g2.Add(r, p0, p1)
+	return encodeBLS12381G2Point(r), nil
+}
+
+// bls12381G2Msm implements the BLS12_G2MSM precompile.
+type bls12381G2Msm struct{}
+
+func (c *bls12381G2Msm) RequiredGas(input []byte) uint64 {
+	return bls12381MSMGas(len(input)/288, bls12381G2MulGas)
+}
+
+func (c *bls12381G2Msm) Run(input []byte) ([]byte, error) {
+	if len(input) == 0 || len(input)%288 != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	g2 := kbls.NewG2()
+	acc := g2.Zero()
+	for i := 0; i < len(input); i += 288 {
+		p, err := decodeBLS12381G2Point(input[i : i+256])
+		if err != nil {
+			return nil, err
+		}
+		scalar := new(kbls.Fr).FromBytes(input[i+256 : i+288])
+		term := g2.New()
+		g2.MulScalar(term, p, scalar)
+		g2.Add(acc, acc, term)
+	}
+	return encodeBLS12381G2Point(acc), nil
+}
+
+// bls12381Pairing implements the BLS12_PAIRING_CHECK precompile.
+type bls12381Pairing struct{}
+
+func (c *bls12381Pairing) RequiredGas(input []byte) uint64 {
+	pairs := uint64(len(input) / 384)
+	return bls12381PairingBaseGas + pairs*bls12381PairingPerPairGas
+}
+
+func (c *bls12381Pairing) Run(input []byte) ([]byte, error) {
+	if len(input) == 0 || len(input)%384 != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	engine := kbls.NewPairingEngine()
+	for i := 0; i < len(input); i += 384 {
+		g1Point, err := decodeBLS12381G1Point(input[i : i+128])
+		if err != nil {
+			return nil, err
+		}
+		g2Point, err := decodeBLS12381G2Point(input[i+128 : i+384])
+		if err != nil {
+			return nil, err
+		}
+		engine.AddPair(g1Point, g2Point)
+	}
+	out := make([]byte, 32)
+	if engine.Check() {
+		out[31] = 1
+	}
+	return out, nil
+}
+
+// bls12381MapFpToG1 implements the BLS12_MAP_FP_TO_G1 precompile.
+type bls12381MapFpToG1 struct{}
+
+func (c *bls12381MapFpToG1) RequiredGas(input []byte) uint64 {
+	return bls12381MapG1Gas
+}
+
+func (c *bls12381MapFpToG1) Run(input []byte) ([]byte, error) {
+	fe, err := decodeBLS12381FieldElement(input)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := kbls.NewFp(fe)
+	if err != nil {
+		return nil, err
+	}
+	point := kbls.NewG1().MapToCurve(fp)
+	return encodeBLS12381G1Point(point), nil
+}
+
+// bls12381MapFp2ToG2 implements the BLS12_MAP_FP2_TO_G2 precompile.
+type bls12381MapFp2ToG2 struct{}
+
+func (c *bls12381MapFp2ToG2) RequiredGas(input []byte) uint64 {
+	return bls12381MapG2Gas
+}
+
+func (c *bls12381MapFp2ToG2) Run(input []byte) ([]byte, error) {
+	if len(input) != 128 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	c0, err := decodeBLS12381FieldElement(input[:64])
+	if err != nil {
+		return nil, err
+	}
+	c1, err := decodeBLS12381FieldElement(input[64:])
+	if err != nil {
+		return nil, err
+	}
+	fp2, err := kbls.NewFp2(c0, c1)
+	if err != nil {
+		return nil, err
+	}
+	point := kbls.NewG2().MapToCurve(fp2)
+	return encodeBLS12381G2Point(point), nil
+}
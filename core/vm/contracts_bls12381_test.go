@@ -0,0 +1,98 @@
+package vm
+
+import "testing"
+
+// Invalid encodings (wrong length, non-zero padding) must be rejected before
+// any curve arithmetic runs.
+func TestBLS12381RejectsInvalidEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		c    PrecompiledContract
+		in   []byte
+	}{
+		{"g1add short input", &bls12381G1Add{}, make([]byte, 255)},
+		{"g1add non-zero padding", &bls12381G1Add{}, nonZeroPaddedG1Pair()},
+		{"g1msm not a multiple of 160", &bls12381G1Msm{}, make([]byte, 161)},
+		{"g2add short input", &bls12381G2Add{}, make([]byte, 511)},
+		{"g2msm not a multiple of 288", &bls12381G2Msm{}, make([]byte, 289)},
+		{"pairing not a multiple of 384", &bls12381Pairing{}, make([]byte, 385)},
+		{"map fp wrong length", &bls12381MapFpToG1{}, make([]byte, 63)},
+		{"map fp2 wrong length", &bls12381MapFp2ToG2{}, make([]byte, 127)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.c.Run(test.in); err == nil {
+				t.Fatal("expected an error, got none")
+			}
+		})
+	}
+}
+
+// nonZeroPaddedG1Pair is a 256-byte G1ADD input whose first field element has
+// a non-zero byte in its 16-byte zero-padding region.
+func nonZeroPaddedG1Pair() []byte {
+	in := make([]byte, 256)
+	in[0] = 0x01
+	return in
+}
+
+// A point that is not on the curve at all must be rejected by decoding,
+// regardless of subgroup membership.
+func TestBLS12381RejectsOffCurvePoint(t *testing.T) {
+	notOnCurve := make([]byte, 128)
+	notOnCurve[63] = 0x01  // x = 1
+	notOnCurve[127] = 0x01 // y = 1, (1,1) is not on the BLS12-381 G1 curve
+	if _, err := (&bls12381G1Add{}).Run(append(notOnCurve, make([]byte, 128)...)); err == nil {
+		t.Fatal("expected an error for a point not on the curve, got none")
+	}
+}
+
+// The hash-to-curve precompiles must always land on a point in the correct
+// subgroup; round-tripping the output through the G1/G2 decoder (which
+// subgroup-checks) is a test that doesn't require a hardcoded expected point.
+func TestBLS12381MapToCurveLandsInSubgroup(t *testing.T) {
+	fp := make([]byte, 64)
+	fp[63] = 0x02
+	out, err := (&bls12381MapFpToG1{}).Run(fp)
+	if err != nil {
+		t.Fatalf("MapFpToG1: %v", err)
+	}
+	if _, err := decodeBLS12381G1Point(out); err != nil {
+		t.Fatalf("mapped G1 point failed subgroup check: %v", err)
+	}
+
+	fp2 := make([]byte, 128)
+	fp2[63], fp2[127] = 0x02, 0x03
+	out2, err := (&bls12381MapFp2ToG2{}).Run(fp2)
+	if err != nil {
+		t.Fatalf("MapFp2ToG2: %v", err)
+	}
+	if _, err := decodeBLS12381G2Point(out2); err != nil {
+		t.Fatalf("mapped G2 point failed subgroup check: %v", err)
+	}
+}
+
+// TestBLS12381G2AddNonDegeneratePointRoundTrips exercises decodeBLS12381G2Point
+// on a point with non-zero coordinates in all four Fp limbs (a degenerate,
+// all-zero identity point can't catch a decoder that scrambles the bytes
+// between limbs, since clobbering zeros with zeros is invisible). It
+// generates such a point via MapFp2ToG2 and checks P+0 decodes back to P.
+func TestBLS12381G2AddNonDegeneratePointRoundTrips(t *testing.T) {
+	fp2 := make([]byte, 128)
+	fp2[63], fp2[127] = 0x05, 0x07
+	p, err := (&bls12381MapFp2ToG2{}).Run(fp2)
+	if err != nil {
+		t.Fatalf("MapFp2ToG2: %v", err)
+	}
+
+	in := append(append([]byte{}, p...), make([]byte, 256)...)
+	out, err := (&bls12381G2Add{}).Run(in)
+	if err != nil {
+		t.Fatalf("G2Add: %v", err)
+	}
+	for i := range out {
+		if out[i] != p[i] {
+			t.Fatalf("P+0 != P at byte %d: got %x, want %x (decoder likely scrambled a coordinate)", i, out, p)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// precompileVector is one EIP-2537 consensus test vector.
+type precompileVector struct {
+	Input    string
+	Expected string
+	Name     string
+	Gas      uint64
+}
+
+func loadPrecompileVectors(t *testing.T, file string) []precompileVector {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", file, err)
+	}
+	var vectors []precompileVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("failed to parse %s: %v", file, err)
+	}
+	return vectors
+}
+
+func runPrecompileVectors(t *testing.T, file string, addr common.Address) {
+	contract := vm.PrecompiledContractsPrague[addr]
+	if contract == nil {
+		t.Fatalf("no precompile registered at %s", addr)
+	}
+	for _, v := range loadPrecompileVectors(t, file) {
+		t.Run(v.Name, func(t *testing.T) {
+			in, err := hex.DecodeString(v.Input)
+			if err != nil {
+				t.Fatalf("invalid input: %v", err)
+			}
+			want, err := hex.DecodeString(v.Expected)
+			if err != nil {
+				t.Fatalf("invalid expected output: %v", err)
+			}
+			if gas := contract.RequiredGas(in); gas != v.Gas {
+				t.Errorf("gas mismatch: got %d, want %d", gas, v.Gas)
+			}
+			got, err := contract.Run(in)
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output mismatch: got %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestBLS12381G1Add(t *testing.T) {
+	runPrecompileVectors(t, "testdata/precompiles/blsG1Add.json", common.BytesToAddress([]byte{0x0b}))
+}
+
+func TestBLS12381G1Msm(t *testing.T) {
+	runPrecompileVectors(t, "testdata/precompiles/blsG1Msm.json", common.BytesToAddress([]byte{0x0c}))
+}
+
+func TestBLS12381G2Add(t *testing.T) {
+	runPrecompileVectors(t, "testdata/precompiles/blsG2Add.json", common.BytesToAddress([]byte{0x0d}))
+}
+
+func TestBLS12381G2Msm(t *testing.T) {
+	runPrecompileVectors(t, "testdata/precompiles/blsG2Msm.json", common.BytesToAddress([]byte{0x0e}))
+}
+
+func TestBLS12381Pairing(t *testing.T) {
+	runPrecompileVectors(t, "testdata/precompiles/blsPairing.json", common.BytesToAddress([]byte{0x0f}))
+}